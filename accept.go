@@ -0,0 +1,217 @@
+package websocket
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompressionOptions lets a server cap the permessage-deflate parameters it
+// is willing to negotiate, independent of the CompressionMode it otherwise
+// applies.
+type CompressionOptions struct {
+	// ClientMaxWindowBits, if non-zero, is the largest client_max_window_bits
+	// value this side will accept from (or offer to, when dialing) a peer,
+	// in the range 8-15. Zero means no cap is advertised.
+	ClientMaxWindowBits int
+
+	// ServerMaxWindowBits, if non-zero, is the largest server_max_window_bits
+	// value this side will accept from (or offer to, when dialing) a peer,
+	// in the range 8-15. Zero means no cap is advertised.
+	ServerMaxWindowBits int
+}
+
+// extensionParams holds the parsed parameters of a single offered or
+// accepted permessage-deflate extension token from a Sec-WebSocket-Extensions
+// header value, e.g. "permessage-deflate; client_max_window_bits".
+type extensionParams map[string]string
+
+// parseDeflateOffer extracts the first "permessage-deflate" token's
+// parameters out of a Sec-WebSocket-Extensions header value. ok is false if
+// the header does not offer permessage-deflate at all.
+func parseDeflateOffer(header string) (params extensionParams, ok bool) {
+	for _, offer := range strings.Split(header, ",") {
+		parts := strings.Split(offer, ";")
+		name := strings.TrimSpace(parts[0])
+		if !strings.EqualFold(name, "permessage-deflate") {
+			continue
+		}
+
+		params = extensionParams{}
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			kv := strings.SplitN(p, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			val := ""
+			if len(kv) == 2 {
+				val = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			params[key] = val
+		}
+		return params, true
+	}
+	return nil, false
+}
+
+// windowBitsParam parses a *_max_window_bits parameter value. present is
+// false if the parameter was absent; err is set if it was present but not a
+// valid 8-15 bits value.
+func windowBitsParam(params extensionParams, name string) (bits int, present bool, err error) {
+	v, ok := params[name]
+	if !ok {
+		return 0, false, nil
+	}
+	if v == "" {
+		// A bare parameter (e.g. client_max_window_bits with no value, which
+		// is only valid in a client's offer) means "negotiate a value for
+		// me"; we treat that the same as not specifying a preference.
+		return 0, true, nil
+	}
+	bits, err = strconv.Atoi(v)
+	if err != nil || bits < 8 || bits > 15 {
+		return 0, true, fmt.Errorf("invalid %s value %q", name, v)
+	}
+	return bits, true, nil
+}
+
+// parseOfferedExtensions splits a Sec-WebSocket-Extensions header value into
+// every offered extension token, keyed by lowercased extension name.
+func parseOfferedExtensions(header string) map[string]extensionParams {
+	offers := map[string]extensionParams{}
+	for _, offer := range strings.Split(header, ",") {
+		parts := strings.Split(offer, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+
+		params := extensionParams{}
+		for _, p := range parts[1:] {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			kv := strings.SplitN(p, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			val := ""
+			if len(kv) == 2 {
+				val = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			}
+			params[key] = val
+		}
+		offers[name] = params
+	}
+	return offers
+}
+
+// acceptExtensions picks the first of codecs and permessage-deflate, in
+// candidateCodecs preference order, whose extension the client actually
+// offered in header. It returns the compressionOptions to apply to the
+// accepted Conn and the Sec-WebSocket-Extensions response value to echo
+// back, or ok=false if nothing offered was acceptable.
+func acceptExtensions(mode CompressionMode, limits CompressionOptions, codecs []CompressionCodec, header string) (copts *compressionOptions, response string, ok bool, err error) {
+	offers := parseOfferedExtensions(header)
+
+	winner, params, err := negotiateCodec(candidateCodecs(mode, codecs), offers)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if winner == nil {
+		return nil, "", false, nil
+	}
+
+	if isDeflate(winner) {
+		return acceptDeflateParams(mode, limits, params)
+	}
+
+	co := &compressionOptions{
+		mode:                    CompressionNoContextTakeover,
+		clientNoContextTakeover: true,
+		serverNoContextTakeover: true,
+		codec:                   winner,
+	}
+	return co, winner.Extension(), true, nil
+}
+
+// acceptDeflate decides whether to accept a client's permessage-deflate
+// offer. mode is the server's configured CompressionMode; limits caps the
+// window bits the server is willing to negotiate. It returns the
+// compressionOptions to apply to the accepted Conn and the
+// Sec-WebSocket-Extensions response header value to echo back, or ok=false
+// if the offer should be declined (falling back to no extension).
+func acceptDeflate(mode CompressionMode, limits CompressionOptions, offer string) (copts *compressionOptions, response string, ok bool, err error) {
+	if mode == CompressionDisabled {
+		return nil, "", false, nil
+	}
+
+	params, found := parseDeflateOffer(offer)
+	if !found {
+		return nil, "", false, nil
+	}
+
+	return acceptDeflateParams(mode, limits, params)
+}
+
+// acceptDeflateParams is the parameter-already-parsed core of acceptDeflate,
+// reused by acceptExtensions once it has split a multi-extension header
+// apart.
+func acceptDeflateParams(mode CompressionMode, limits CompressionOptions, params extensionParams) (copts *compressionOptions, response string, ok bool, err error) {
+	co := mode.opts()
+
+	if _, present := params["client_no_context_takeover"]; present {
+		co.clientNoContextTakeover = true
+	}
+	if _, present := params["server_no_context_takeover"]; present {
+		co.serverNoContextTakeover = true
+	}
+
+	respParts := []string{"permessage-deflate"}
+	if co.clientNoContextTakeover {
+		respParts = append(respParts, "client_no_context_takeover")
+	}
+	if co.serverNoContextTakeover {
+		respParts = append(respParts, "server_no_context_takeover")
+	}
+
+	clientBits, clientPresent, err := windowBitsParam(params, "client_max_window_bits")
+	if err != nil {
+		return nil, "", false, err
+	}
+	if clientPresent {
+		co.clientMaxWindowBits = chooseWindowBits(clientBits, limits.ClientMaxWindowBits)
+		respParts = append(respParts, fmt.Sprintf("client_max_window_bits=%d", co.clientMaxWindowBits))
+	}
+
+	serverBits, serverPresent, err := windowBitsParam(params, "server_max_window_bits")
+	if err != nil {
+		return nil, "", false, err
+	}
+	if serverPresent {
+		co.serverMaxWindowBits = chooseWindowBits(serverBits, limits.ServerMaxWindowBits)
+		respParts = append(respParts, fmt.Sprintf("server_max_window_bits=%d", co.serverMaxWindowBits))
+	} else if limits.ServerMaxWindowBits != 0 && limits.ServerMaxWindowBits < defaultWindowBits {
+		co.serverMaxWindowBits = limits.ServerMaxWindowBits
+		respParts = append(respParts, fmt.Sprintf("server_max_window_bits=%d", co.serverMaxWindowBits))
+	}
+
+	return co, strings.Join(respParts, "; "), true, nil
+}
+
+// chooseWindowBits picks the smallest (most memory conserving) of a value a
+// peer offered and a limit this side configured; a zero bits or limit means
+// "no preference"/defaultWindowBits.
+func chooseWindowBits(offered, limit int) int {
+	if offered == 0 {
+		offered = defaultWindowBits
+	}
+	if limit == 0 {
+		limit = defaultWindowBits
+	}
+	if offered < limit {
+		return offered
+	}
+	return limit
+}
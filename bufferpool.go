@@ -0,0 +1,23 @@
+package websocket
+
+// BufferPool pools the scratch buffers used to frame (and, where
+// applicable, compress) outgoing writes, so that a server holding many
+// thousands of mostly-idle Conns does not pay a fixed-size write buffer
+// pinned to every connection for its whole lifetime.
+//
+// Get and Put must be safe for concurrent use: different Conns may check
+// buffers in and out of the same pool at the same time. A buffer obtained
+// from Get is only checked out for the duration of a single Conn.Write or
+// Conn.Writer call; it is returned via Put no later than when that write has
+// been flushed to the underlying connection (a compression scratch buffer
+// is returned as soon as its output has been copied out).
+type BufferPool interface {
+	// Get returns a buffer from the pool, allocating a new one if the pool
+	// is empty. The returned slice's length and contents are unspecified;
+	// callers reset it (e.g. via a zero-length reslice) before use.
+	Get() *[]byte
+
+	// Put returns a buffer previously obtained from Get back to the pool.
+	// The caller must not use or retain the buffer afterwards.
+	Put(*[]byte)
+}
@@ -0,0 +1,161 @@
+//go:build !js
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aperturerobotics/go-websocket/internal/test/assert"
+)
+
+// syncBufferPool is a sync.Pool-backed BufferPool, the shape a caller would
+// plug in to share write buffers across many Conns.
+type syncBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *syncBufferPool) Get() *[]byte {
+	if b, ok := p.pool.Get().(*[]byte); ok {
+		return b
+	}
+	b := make([]byte, 0, 4096)
+	return &b
+}
+
+func (p *syncBufferPool) Put(b *[]byte) {
+	p.pool.Put(b)
+}
+
+// TestWriteBufferPoolRoundtrip verifies that messages written through a
+// Conn configured with a WriteBufferPool still frame and (where applicable)
+// compress correctly.
+func TestWriteBufferPoolRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		mode CompressionMode
+	}{
+		{"Disabled", CompressionDisabled},
+		{"NoContextTakeover", CompressionNoContextTakeover},
+		{"ContextTakeover", CompressionContextTakeover},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+
+			pool := &syncBufferPool{}
+			client := newConn(connConfig{
+				rwc:             clientConn,
+				client:          true,
+				copts:           tc.mode.opts(),
+				flateThreshold:  8,
+				br:              bufio.NewReader(clientConn),
+				bw:              bufio.NewWriterSize(clientConn, 4096),
+				writeBufferPool: pool,
+			})
+			server := newConn(connConfig{
+				rwc:            serverConn,
+				client:         false,
+				copts:          tc.mode.opts(),
+				flateThreshold: 8,
+				br:             bufio.NewReader(serverConn),
+				bw:             bufio.NewWriterSize(serverConn, 4096),
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			for i := 0; i < 3; i++ {
+				msg := []byte(strings.Repeat("pooled message ", 50))
+
+				writeDone := make(chan error, 1)
+				go func() {
+					writeDone <- client.Write(ctx, MessageBinary, msg)
+				}()
+
+				typ, got, err := server.Read(ctx)
+				assert.Success(t, err)
+				assert.Success(t, <-writeDone)
+				assert.Equal(t, "message type", MessageBinary, typ)
+
+				if !bytes.Equal(msg, got) {
+					t.Fatalf("round %d: message corrupted when using a WriteBufferPool", i)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWriteFanout compares the steady-state heap held by many idle
+// Conns with and without a shared WriteBufferPool, the scenario a pubsub
+// server holding thousands of idle connections cares about.
+func BenchmarkWriteFanout(b *testing.B) {
+	const connCount = 1000
+	msg := []byte(strings.Repeat("fanout payload ", 50))
+
+	// run builds connCount idle Conns and writes msg once to every one of
+	// them (so all per-message scratch state has been touched), then
+	// reports the steady-state heap held by the now-idle Conns.
+	run := func(b *testing.B, pool BufferPool) {
+		for n := 0; n < b.N; n++ {
+			conns := make([]*Conn, connCount)
+			for i := range conns {
+				clientConn, serverConn := net.Pipe()
+				b.Cleanup(func() { clientConn.Close() })
+				b.Cleanup(func() { serverConn.Close() })
+				go io.Copy(io.Discard, serverConn)
+
+				cfg := connConfig{
+					rwc:             clientConn,
+					client:          true,
+					copts:           CompressionNoContextTakeover.opts(),
+					flateThreshold:  8,
+					br:              bufio.NewReader(clientConn),
+					writeBufferPool: pool,
+				}
+				if pool == nil {
+					// Without a pool, the persistent write buffer is pinned
+					// to the Conn for its whole lifetime, as it always has
+					// been; with one, writeFrame never touches bw.
+					cfg.bw = bufio.NewWriterSize(clientConn, 4096)
+				}
+				conns[i] = newConn(cfg)
+			}
+
+			ctx := context.Background()
+			for _, c := range conns {
+				if err := c.Write(ctx, MessageBinary, msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			runtime.GC()
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			runtime.KeepAlive(conns)
+			b.ReportMetric(float64(stats.HeapAlloc)/float64(connCount), "idle-bytes/conn")
+		}
+	}
+
+	b.Run("NoPool", func(b *testing.B) {
+		run(b, nil)
+	})
+	b.Run("WithPool", func(b *testing.B) {
+		run(b, &syncBufferPool{})
+	})
+}
@@ -0,0 +1,130 @@
+package websocket
+
+import "io"
+
+// CompressionCodec is a pluggable per-message compression scheme negotiated
+// through the Sec-WebSocket-Extensions header, of which permessage-deflate
+// (see compress.go) is the built-in default. Implementing this lets
+// applications trade permessage-deflate's compression ratio for a cheaper
+// compressor when CPU, not bandwidth, is the bottleneck.
+//
+// Unlike permessage-deflate, a CompressionCodec compresses each message
+// independently: NewWriter/NewReader are called fresh per message, so a
+// codec cannot retain a cross-message dictionary the way
+// CompressionContextTakeover does for permessage-deflate.
+type CompressionCodec interface {
+	// NewWriter returns a writer that compresses to w. Closing it flushes
+	// the complete compressed message.
+	NewWriter(w io.Writer) io.WriteCloser
+
+	// NewReader returns a reader that decompresses exactly one message's
+	// worth of data from r.
+	NewReader(r io.Reader) io.ReadCloser
+
+	// Extension is the Sec-WebSocket-Extensions token this codec
+	// negotiates, e.g. "permessage-deflate" or "permessage-s2".
+	Extension() string
+
+	// Negotiate inspects the parameters a peer offered (when accepting) or
+	// responded with (when dialing) for this codec's extension token and
+	// reports whether they're acceptable.
+	Negotiate(params map[string]string) (accepted bool, err error)
+}
+
+// deflateCodec adapts the built-in permessage-deflate implementation to the
+// CompressionCodec interface so it can participate in the same offer/accept
+// list as user-registered codecs. It is always implicitly available;
+// AcceptOptions.CompressionCodecs/DialOptions.CompressionCodecs only add to
+// it.
+type deflateCodec struct{}
+
+func (deflateCodec) Extension() string { return "permessage-deflate" }
+
+func (deflateCodec) Negotiate(params map[string]string) (bool, error) {
+	return true, nil
+}
+
+// NewWriter and NewReader are never called on deflateCodec: Conn uses its
+// own deflate/inflate methods for permessage-deflate so that
+// CompressionContextTakeover and client_max_window_bits/
+// server_max_window_bits keep working. deflateCodec exists so deflate has a
+// slot in the codec preference list and Extension()/Negotiate() can be
+// reused by the handshake.
+func (deflateCodec) NewWriter(w io.Writer) io.WriteCloser {
+	panic("websocket: deflateCodec.NewWriter is unreachable")
+}
+func (deflateCodec) NewReader(r io.Reader) io.ReadCloser {
+	panic("websocket: deflateCodec.NewReader is unreachable")
+}
+
+// isDeflate reports whether codec is the built-in permessage-deflate codec
+// (including the nil default).
+func isDeflate(codec CompressionCodec) bool {
+	if codec == nil {
+		return true
+	}
+	_, ok := codec.(deflateCodec)
+	return ok
+}
+
+// negotiateCodec picks the first of candidates, in preference order, whose
+// extension token a peer actually offered (present in offers) and whose
+// Negotiate accepts the offered parameters. It returns the winning codec and
+// the parameters it was negotiated with, or a nil codec if nothing matched.
+func negotiateCodec(candidates []CompressionCodec, offers map[string]extensionParams) (codec CompressionCodec, params extensionParams, err error) {
+	for _, candidate := range candidates {
+		p, present := offers[candidate.Extension()]
+		if !present {
+			continue
+		}
+		ok, err := candidate.Negotiate(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			return candidate, p, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// defaultCodecs is used when AcceptOptions.CompressionCodecs/
+// DialOptions.CompressionCodecs is empty: permessage-deflate only, to
+// preserve existing behavior for callers who haven't opted into other
+// codecs.
+func defaultCodecs() []CompressionCodec {
+	return []CompressionCodec{deflateCodec{}}
+}
+
+// hasDeflate reports whether codecs already contains the built-in
+// permessage-deflate codec.
+func hasDeflate(codecs []CompressionCodec) bool {
+	for _, codec := range codecs {
+		if isDeflate(codec) {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateCodecs returns the codecs accept/offer negotiation should try, in
+// preference order. A caller's CompressionCodecs are tried in the order
+// given; permessage-deflate is appended at the end as an implicit fallback
+// whenever mode allows it and the caller didn't already list it explicitly,
+// so a caller can prefer a registered codec over deflate just by listing it
+// first. An empty CompressionCodecs falls back to defaultCodecs, preserving
+// deflate-only behavior for callers who haven't opted into other codecs.
+func candidateCodecs(mode CompressionMode, codecs []CompressionCodec) []CompressionCodec {
+	if len(codecs) == 0 {
+		if mode == CompressionDisabled {
+			return nil
+		}
+		return defaultCodecs()
+	}
+
+	candidates := append([]CompressionCodec(nil), codecs...)
+	if mode != CompressionDisabled && !hasDeflate(candidates) {
+		candidates = append(candidates, deflateCodec{})
+	}
+	return candidates
+}
@@ -0,0 +1,139 @@
+//go:build !js
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aperturerobotics/go-websocket/internal/test/assert"
+)
+
+// TestAcceptExtensionsS2 verifies that a client offering both
+// permessage-deflate and permessage-s2 gets permessage-s2 back when the
+// server is configured to prefer it.
+func TestAcceptExtensionsS2(t *testing.T) {
+	t.Parallel()
+
+	codecs := []CompressionCodec{NewS2Codec()}
+
+	copts, response, ok, err := acceptExtensions(
+		CompressionDisabled, // server doesn't want deflate at all here
+		CompressionOptions{},
+		codecs,
+		"permessage-deflate, permessage-s2",
+	)
+	assert.Success(t, err)
+	assert.Equal(t, "accepted", true, ok)
+	assert.Equal(t, "response", "permessage-s2", response)
+
+	if !isDeflate(copts.codec) {
+		if copts.codec.Extension() != "permessage-s2" {
+			t.Fatalf("expected permessage-s2, got %s", copts.codec.Extension())
+		}
+	} else {
+		t.Fatal("expected a non-deflate codec to be negotiated")
+	}
+}
+
+// TestAcceptExtensionsPrefersRegisteredCodec verifies that a registered
+// codec is preferred over permessage-deflate when both are offered, without
+// the caller having to disable deflate entirely: CompressionCodecs order
+// wins, with deflate as an implicit fallback behind it.
+func TestAcceptExtensionsPrefersRegisteredCodec(t *testing.T) {
+	t.Parallel()
+
+	codecs := []CompressionCodec{NewS2Codec()}
+
+	copts, response, ok, err := acceptExtensions(
+		CompressionContextTakeover,
+		CompressionOptions{},
+		codecs,
+		"permessage-deflate, permessage-s2",
+	)
+	assert.Success(t, err)
+	assert.Equal(t, "accepted", true, ok)
+	assert.Equal(t, "negotiated s2", false, isDeflate(copts.codec))
+	assert.Equal(t, "response", "permessage-s2", response)
+
+	if strings.Contains(response, "permessage-deflate") {
+		t.Fatalf("expected no permessage-deflate in response, got %q", response)
+	}
+}
+
+// TestAcceptExtensionsDeflateFallback verifies that permessage-deflate still
+// wins when it's the only extension actually offered, even with a
+// registered codec configured ahead of it in preference order.
+func TestAcceptExtensionsDeflateFallback(t *testing.T) {
+	t.Parallel()
+
+	codecs := []CompressionCodec{NewS2Codec()}
+
+	copts, response, ok, err := acceptExtensions(
+		CompressionContextTakeover,
+		CompressionOptions{},
+		codecs,
+		"permessage-deflate",
+	)
+	assert.Success(t, err)
+	assert.Equal(t, "accepted", true, ok)
+	assert.Equal(t, "negotiated deflate", true, isDeflate(copts.codec))
+
+	if !strings.Contains(response, "permessage-deflate") {
+		t.Fatalf("expected a permessage-deflate response, got %q", response)
+	}
+}
+
+// TestS2Roundtrip verifies that a message compressed with the permessage-s2
+// codec round-trips correctly between two Conns.
+func TestS2Roundtrip(t *testing.T) {
+	t.Parallel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	copts := &compressionOptions{mode: CompressionNoContextTakeover, codec: NewS2Codec()}
+
+	client := newConn(connConfig{
+		rwc:            clientConn,
+		client:         true,
+		copts:          copts,
+		flateThreshold: 8,
+		br:             bufio.NewReader(clientConn),
+		bw:             bufio.NewWriterSize(clientConn, 4096),
+	})
+
+	server := newConn(connConfig{
+		rwc:            serverConn,
+		client:         false,
+		copts:          copts,
+		flateThreshold: 8,
+		br:             bufio.NewReader(serverConn),
+		bw:             bufio.NewWriterSize(serverConn, 4096),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg := []byte(strings.Repeat("permessage-s2 payload ", 200))
+
+	writeDone := make(chan error, 1)
+	go func() {
+		writeDone <- client.Write(ctx, MessageBinary, msg)
+	}()
+
+	typ, got, err := server.Read(ctx)
+	assert.Success(t, err)
+	assert.Success(t, <-writeDone)
+	assert.Equal(t, "message type", MessageBinary, typ)
+
+	if !bytes.Equal(msg, got) {
+		t.Fatal("message corrupted through permessage-s2 codec")
+	}
+}
@@ -0,0 +1,201 @@
+package websocket
+
+import "io"
+
+// CompressionMode controls when the permessage-deflate extension (RFC 7692)
+// is used and whether the flate dictionary is retained between messages.
+type CompressionMode int
+
+const (
+	// CompressionDisabled disables permessage-deflate entirely; it is
+	// neither offered nor accepted. Codecs listed in CompressionCodecs are
+	// still negotiated.
+	CompressionDisabled CompressionMode = iota
+
+	// CompressionContextTakeover keeps the flate dictionary from previous
+	// messages around for compressing and decompressing later ones. This
+	// gives the best compression ratio at the cost of retaining flate state
+	// for the lifetime of the Conn.
+	CompressionContextTakeover
+
+	// CompressionNoContextTakeover resets the flate dictionary after every
+	// message. This trades compression ratio for lower per connection
+	// memory use, which matters when holding many idle connections.
+	CompressionNoContextTakeover
+
+	// CompressionServerNoTakeover keeps context takeover for the direction
+	// a peer offered it in, except that the server's own write direction
+	// (server-to-client) always resets its flate dictionary after every
+	// message, regardless of what the other side offered. Per RFC 7692
+	// Section 7.1.3, this lets a server bound its own per-connection memory
+	// (server_no_context_takeover) without forcing clients that want
+	// context takeover to give it up entirely. On a Conn built via Dial,
+	// this instead asks the server to do the same by offering
+	// server_no_context_takeover.
+	CompressionServerNoTakeover
+)
+
+// opts builds the compressionOptions implementing mode for both directions
+// of a connection established without going through extension negotiation
+// (e.g. in tests that construct a Conn directly via newConn).
+func (mode CompressionMode) opts() *compressionOptions {
+	if mode == CompressionDisabled {
+		return nil
+	}
+	return &compressionOptions{
+		mode:                    mode,
+		clientNoContextTakeover: mode == CompressionNoContextTakeover,
+		serverNoContextTakeover: mode == CompressionNoContextTakeover || mode == CompressionServerNoTakeover,
+		clientMaxWindowBits:     defaultWindowBits,
+		serverMaxWindowBits:     defaultWindowBits,
+	}
+}
+
+// defaultWindowBits is the LZ77 window size RFC 7692 assumes when a peer
+// does not send client_max_window_bits/server_max_window_bits at all: the
+// full 32KiB window stdlib flate already uses internally.
+const defaultWindowBits = 15
+
+// compressionOptions holds the permessage-deflate parameters negotiated (or
+// assumed, in the direct-construction case) for a single Conn.
+type compressionOptions struct {
+	mode CompressionMode
+
+	// clientNoContextTakeover and serverNoContextTakeover independently
+	// track whether the client-to-server and server-to-client directions
+	// reset their flate dictionary after every message.
+	clientNoContextTakeover bool
+	serverNoContextTakeover bool
+
+	// clientMaxWindowBits and serverMaxWindowBits cap the LZ77 window used
+	// when compressing in the client-to-server and server-to-client
+	// directions, respectively. Valid range is 8-15; defaultWindowBits (15)
+	// means no reduction was negotiated.
+	clientMaxWindowBits int
+	serverMaxWindowBits int
+
+	// codec is the CompressionCodec negotiated for this connection. nil (and
+	// deflateCodec{}) both mean the built-in permessage-deflate path in
+	// Conn.deflate/Conn.inflate is used; any other value means Conn uses
+	// codec.NewWriter/NewReader instead.
+	codec CompressionCodec
+}
+
+// enabled reports whether a compression extension (permessage-deflate or
+// another negotiated CompressionCodec) is in use at all. A nil
+// receiver is treated as disabled so callers can hold a *compressionOptions
+// that is nil when compression was never negotiated.
+func (co *compressionOptions) enabled() bool {
+	return co != nil && co.mode != CompressionDisabled
+}
+
+// writeNoContextTakeover reports whether the direction this Conn writes in
+// resets its flate dictionary after every message.
+func (co *compressionOptions) writeNoContextTakeover(isClient bool) bool {
+	if !co.enabled() {
+		return true
+	}
+	if isClient {
+		return co.clientNoContextTakeover
+	}
+	return co.serverNoContextTakeover
+}
+
+// readNoContextTakeover reports whether the direction this Conn reads from
+// resets its flate dictionary after every message.
+func (co *compressionOptions) readNoContextTakeover(isClient bool) bool {
+	if !co.enabled() {
+		return true
+	}
+	if isClient {
+		return co.serverNoContextTakeover
+	}
+	return co.clientNoContextTakeover
+}
+
+// writeWindowBits returns the negotiated LZ77 window size, in bits, for the
+// direction this Conn writes in.
+func (co *compressionOptions) writeWindowBits(isClient bool) int {
+	if !co.enabled() {
+		return defaultWindowBits
+	}
+	if isClient {
+		return co.clientMaxWindowBits
+	}
+	return co.serverMaxWindowBits
+}
+
+// readWindowBits returns the negotiated LZ77 window size, in bits, for the
+// direction this Conn reads from.
+func (co *compressionOptions) readWindowBits(isClient bool) int {
+	if !co.enabled() {
+		return defaultWindowBits
+	}
+	if isClient {
+		return co.serverMaxWindowBits
+	}
+	return co.clientMaxWindowBits
+}
+
+// deflateFinalBlock is the 4 byte trailer RFC 7692 Section 7.2.1 says every
+// compressed message ends with (an empty, non-final DEFLATE stored block
+// produced by flate.Writer.Flush) and which senders must strip and
+// receivers must re-append.
+var deflateFinalBlock = []byte{0x00, 0x00, 0xff, 0xff}
+
+// deflateReadTail is appended after deflateFinalBlock when decompressing.
+// Because deflateFinalBlock's stored block is never marked BFINAL, a
+// flate.Reader given only that much input tries to read a further block
+// header and sees a real EOF, reporting io.ErrUnexpectedEOF. Appending one
+// more empty stored block, this time with BFINAL set (the leading 0x01),
+// gives the reader a clean terminator instead.
+var deflateReadTail = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+// flateWriteWrapper lets a persistent flate.Writer be redirected to a new
+// destination for each message without losing its internal LZ77 dictionary,
+// which is what makes CompressionContextTakeover work: the flate.Writer
+// itself is never reset, only where it writes to.
+type flateWriteWrapper struct {
+	w io.Writer
+}
+
+func (fw *flateWriteWrapper) Write(p []byte) (int, error) {
+	return fw.w.Write(p)
+}
+
+// slidingWindow tracks the most recent windowLength bytes written to it. It
+// is used to emulate a bounded LZ77 window when a peer has negotiated a
+// client_max_window_bits/server_max_window_bits smaller than the default 15
+// (see RFC 7692 Section 7.1.2), by seeding a fresh flate.Writer's dictionary
+// with w.buf instead of letting it grow over the unbounded history a
+// persistent writer would otherwise retain.
+type slidingWindow struct {
+	buf []byte
+}
+
+// init allocates buf with a fixed capacity of windowLength; buf never grows
+// past this capacity.
+func (w *slidingWindow) init(windowLength int) {
+	w.buf = make([]byte, 0, windowLength)
+}
+
+// write records p as the most recently seen bytes, keeping only the last
+// cap(w.buf) bytes seen across all calls.
+func (w *slidingWindow) write(p []byte) {
+	windowLength := cap(w.buf)
+
+	if len(p) >= windowLength {
+		w.buf = w.buf[:windowLength]
+		copy(w.buf, p[len(p)-windowLength:])
+		return
+	}
+
+	keep := windowLength - len(p)
+	if keep > len(w.buf) {
+		keep = len(w.buf)
+	}
+	newLen := keep + len(p)
+	copy(w.buf[:newLen], w.buf[len(w.buf)-keep:])
+	copy(w.buf[keep:newLen], p)
+	w.buf = w.buf[:newLen]
+}
@@ -79,15 +79,18 @@ func TestWriteSingleFrameCompressed(t *testing.T) {
 	)
 
 	testCases := []struct {
-		name     string
-		mode     CompressionMode
-		msg      []byte
-		wantRsv1 bool // true = compressed, false = uncompressed
+		name         string
+		mode         CompressionMode
+		msg          []byte
+		disableWrite bool // SetWriteCompression(false) before writing
+		wantRsv1     bool // true = compressed, false = uncompressed
 	}{
-		{"ContextTakeover/AboveThreshold", CompressionContextTakeover, largeMsg, true},
-		{"NoContextTakeover/AboveThreshold", CompressionNoContextTakeover, largeMsg, true},
-		{"ContextTakeover/BelowThreshold", CompressionContextTakeover, smallMsg, false},
-		{"NoContextTakeover/BelowThreshold", CompressionNoContextTakeover, smallMsg, false},
+		{"ContextTakeover/AboveThreshold", CompressionContextTakeover, largeMsg, false, true},
+		{"NoContextTakeover/AboveThreshold", CompressionNoContextTakeover, largeMsg, false, true},
+		{"ContextTakeover/BelowThreshold", CompressionContextTakeover, smallMsg, false, false},
+		{"NoContextTakeover/BelowThreshold", CompressionNoContextTakeover, smallMsg, false, false},
+		{"ContextTakeover/DisabledAboveThreshold", CompressionContextTakeover, largeMsg, true, false},
+		{"NoContextTakeover/DisabledAboveThreshold", CompressionNoContextTakeover, largeMsg, true, false},
 	}
 
 	for _, tc := range testCases {
@@ -106,6 +109,9 @@ func TestWriteSingleFrameCompressed(t *testing.T) {
 				br:             bufio.NewReader(clientConn),
 				bw:             bufio.NewWriterSize(clientConn, 4096),
 			})
+			if tc.disableWrite {
+				c.SetWriteCompression(false)
+			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
 			defer cancel()
@@ -134,6 +140,59 @@ func TestWriteSingleFrameCompressed(t *testing.T) {
 	}
 }
 
+// TestSetCompressionLevel verifies that SetCompressionLevel rejects values
+// outside the compress/flate range and that, after a valid level is set, the
+// next write is still sent compressed.
+func TestSetCompressionLevel(t *testing.T) {
+	t.Parallel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	c := newConn(connConfig{
+		rwc:            clientConn,
+		client:         true,
+		copts:          CompressionNoContextTakeover.opts(),
+		flateThreshold: 8,
+		br:             bufio.NewReader(clientConn),
+		bw:             bufio.NewWriterSize(clientConn, 4096),
+	})
+
+	err := c.SetCompressionLevel(flate.HuffmanOnly - 1)
+	if err == nil {
+		t.Fatal("expected error for level below flate.HuffmanOnly")
+	}
+
+	err = c.SetCompressionLevel(flate.BestCompression + 1)
+	if err == nil {
+		t.Fatal("expected error for level above flate.BestCompression")
+	}
+
+	assert.Success(t, c.SetCompressionLevel(flate.BestSpeed))
+
+	msg := []byte(strings.Repeat("hello world ", 100))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	writeDone := make(chan error, 1)
+	go func() {
+		writeDone <- c.Write(ctx, MessageText, msg)
+	}()
+
+	reader := bufio.NewReader(serverConn)
+	readBuf := make([]byte, 8)
+
+	h, err := readFrameHeader(reader, readBuf)
+	assert.Success(t, err)
+	assert.Equal(t, "rsv1 (compressed)", true, h.rsv1)
+
+	_, err = io.CopyN(io.Discard, reader, h.payloadLength)
+	assert.Success(t, err)
+	assert.Success(t, <-writeDone)
+}
+
 // TestWriteThenWriterContextTakeover verifies that using Conn.Write followed by
 // Conn.Writer works correctly with context takeover enabled. This tests that
 // the flateWriter destination is properly restored after Conn.Write redirects
@@ -309,3 +368,202 @@ func TestCompressionDictionaryPreserved(t *testing.T) {
 			withTakeoverSizes[2], withoutTakeoverSizes[2])
 	}
 }
+
+// TestAcceptDeflateWindowBits verifies that a server offered
+// client_max_window_bits=10 echoes that value back in its response instead
+// of silently ignoring it.
+func TestAcceptDeflateWindowBits(t *testing.T) {
+	t.Parallel()
+
+	copts, response, ok, err := acceptDeflate(
+		CompressionContextTakeover,
+		CompressionOptions{},
+		"permessage-deflate; client_max_window_bits=10",
+	)
+	assert.Success(t, err)
+	assert.Equal(t, "accepted", true, ok)
+	assert.Equal(t, "negotiated client window bits", 10, copts.clientMaxWindowBits)
+
+	if !strings.Contains(response, "client_max_window_bits=10") {
+		t.Fatalf("response does not echo accepted client_max_window_bits: %q", response)
+	}
+}
+
+// TestAcceptDeflateWindowBitsServerLimit verifies that a server configured
+// with a ServerMaxWindowBits cap advertises it even when the client didn't
+// ask for server_max_window_bits at all.
+func TestAcceptDeflateWindowBitsServerLimit(t *testing.T) {
+	t.Parallel()
+
+	copts, response, ok, err := acceptDeflate(
+		CompressionContextTakeover,
+		CompressionOptions{ServerMaxWindowBits: 9},
+		"permessage-deflate",
+	)
+	assert.Success(t, err)
+	assert.Equal(t, "accepted", true, ok)
+	assert.Equal(t, "negotiated server window bits", 9, copts.serverMaxWindowBits)
+
+	if !strings.Contains(response, "server_max_window_bits=9") {
+		t.Fatalf("response does not advertise server_max_window_bits cap: %q", response)
+	}
+}
+
+// TestAcceptServerNoTakeover verifies that a server configured with
+// CompressionServerNoTakeover forces server_no_context_takeover into its
+// response even when the client's offer asks for full context takeover in
+// both directions.
+func TestAcceptServerNoTakeover(t *testing.T) {
+	t.Parallel()
+
+	copts, response, ok, err := acceptDeflate(
+		CompressionServerNoTakeover,
+		CompressionOptions{},
+		"permessage-deflate",
+	)
+	assert.Success(t, err)
+	assert.Equal(t, "accepted", true, ok)
+	assert.Equal(t, "client direction keeps takeover", false, copts.clientNoContextTakeover)
+	assert.Equal(t, "server direction drops takeover", true, copts.serverNoContextTakeover)
+
+	if !strings.Contains(response, "server_no_context_takeover") {
+		t.Fatalf("response does not advertise server_no_context_takeover: %q", response)
+	}
+	if strings.Contains(response, "client_no_context_takeover") {
+		t.Fatalf("response should not force client_no_context_takeover: %q", response)
+	}
+}
+
+// TestServerNoTakeoverRoundtrip verifies that a server using
+// CompressionServerNoTakeover against a client offering full takeover
+// decodes messages correctly in both directions, even though only the
+// client-to-server direction preserves its flate dictionary.
+func TestServerNoTakeoverRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	serverCopts := &compressionOptions{
+		mode:                    CompressionServerNoTakeover,
+		serverNoContextTakeover: true,
+		clientMaxWindowBits:     defaultWindowBits,
+		serverMaxWindowBits:     defaultWindowBits,
+	}
+	clientCopts := &compressionOptions{
+		mode:                CompressionContextTakeover,
+		clientMaxWindowBits: defaultWindowBits,
+		serverMaxWindowBits: defaultWindowBits,
+	}
+
+	client := newConn(connConfig{
+		rwc:            clientConn,
+		client:         true,
+		copts:          clientCopts,
+		flateThreshold: 8,
+		br:             bufio.NewReader(clientConn),
+		bw:             bufio.NewWriterSize(clientConn, 4096),
+	})
+
+	server := newConn(connConfig{
+		rwc:            serverConn,
+		client:         false,
+		copts:          serverCopts,
+		flateThreshold: 8,
+		br:             bufio.NewReader(serverConn),
+		bw:             bufio.NewWriterSize(serverConn, 4096),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		clientMsg := []byte(strings.Repeat(xrand.String(16), 50))
+
+		writeDone := make(chan error, 1)
+		go func() {
+			writeDone <- client.Write(ctx, MessageBinary, clientMsg)
+		}()
+
+		typ, got, err := server.Read(ctx)
+		assert.Success(t, err)
+		assert.Success(t, <-writeDone)
+		assert.Equal(t, "message type", MessageBinary, typ)
+		if !bytes.Equal(clientMsg, got) {
+			t.Fatalf("round %d: client->server message corrupted", i)
+		}
+
+		serverMsg := []byte(strings.Repeat(xrand.String(16), 50))
+
+		writeDone = make(chan error, 1)
+		go func() {
+			writeDone <- server.Write(ctx, MessageBinary, serverMsg)
+		}()
+
+		typ, got, err = client.Read(ctx)
+		assert.Success(t, err)
+		assert.Success(t, <-writeDone)
+		assert.Equal(t, "message type", MessageBinary, typ)
+		if !bytes.Equal(serverMsg, got) {
+			t.Fatalf("round %d: server->client message corrupted", i)
+		}
+	}
+}
+
+// TestCompressionShrunkWindowRoundtrip verifies that messages compressed
+// with a reduced client_max_window_bits decode correctly on the other end,
+// across several messages so the bounded dictionary is exercised past a
+// single message.
+func TestCompressionShrunkWindowRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	copts := &compressionOptions{
+		mode:                CompressionContextTakeover,
+		clientMaxWindowBits: 10,
+		serverMaxWindowBits: 10,
+	}
+
+	client := newConn(connConfig{
+		rwc:            clientConn,
+		client:         true,
+		copts:          copts,
+		flateThreshold: 8,
+		br:             bufio.NewReader(clientConn),
+		bw:             bufio.NewWriterSize(clientConn, 4096),
+	})
+
+	server := newConn(connConfig{
+		rwc:            serverConn,
+		client:         false,
+		copts:          copts,
+		flateThreshold: 8,
+		br:             bufio.NewReader(serverConn),
+		bw:             bufio.NewWriterSize(serverConn, 4096),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 5; i++ {
+		msg := []byte(strings.Repeat(xrand.String(16), 50))
+
+		writeDone := make(chan error, 1)
+		go func() {
+			writeDone <- client.Write(ctx, MessageBinary, msg)
+		}()
+
+		typ, got, err := server.Read(ctx)
+		assert.Success(t, err)
+		assert.Success(t, <-writeDone)
+		assert.Equal(t, "message type", MessageBinary, typ)
+
+		if !bytes.Equal(msg, got) {
+			t.Fatalf("round %d: message corrupted under shrunk window", i)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// connConfig carries everything newConn needs to wrap an already-upgraded
+// connection. Accept and Dial build one of these after completing the HTTP
+// handshake; tests build one directly against a net.Pipe.
+type connConfig struct {
+	rwc    io.ReadWriteCloser
+	client bool
+
+	copts          *compressionOptions
+	flateThreshold int
+
+	br *bufio.Reader
+	// bw is the persistent write buffer used to frame outgoing writes.
+	// It may be left nil if writeBufferPool is set, since writeFrame then
+	// never touches it.
+	bw *bufio.Writer
+
+	// writeBufferPool, if set, is checked out for the scratch buffer needed
+	// to frame each outgoing write instead of using bw, which otherwise
+	// stays allocated for the lifetime of the Conn; see Conn.writeFrame.
+	writeBufferPool BufferPool
+}
+
+// Conn is an established WebSocket connection, returned by Accept or Dial.
+//
+// Conn's methods are safe for concurrent use, except that at most one
+// Read and one Writer/Write call may be outstanding at a time.
+type Conn struct {
+	rwc    io.ReadWriteCloser
+	client bool
+
+	copts          *compressionOptions
+	flateThreshold int
+
+	br *bufio.Reader
+	bw *bufio.Writer
+
+	writeBufferPool BufferPool
+
+	writeMu   sync.Mutex
+	readMu    sync.Mutex
+	headerBuf [8]byte
+
+	// writeCompressionDisabled and compressionLevel are set via
+	// SetWriteCompression and SetCompressionLevel. They must not be changed
+	// concurrently with an in-flight Write/Writer call.
+	writeCompressionDisabled bool
+	compressionLevel         int
+	compressionLevelSet      bool
+
+	flateWriter     *flate.Writer
+	flateWriteProxy flateWriteWrapper
+	flateReader     io.Reader
+
+	// writeWindow backs the bounded-dictionary fallback used for writing
+	// when the peer negotiated a client_max_window_bits/server_max_window_bits
+	// smaller than defaultWindowBits; see deflate.
+	//
+	// readWindow backs every context-takeover read regardless of negotiated
+	// window bits, since flate.Reader needs an explicit preset dictionary
+	// rather than the persistent-writer trick deflate uses; see inflate.
+	writeWindow slidingWindow
+	readWindow  slidingWindow
+}
+
+// newConn constructs a Conn from cfg. It assumes the WebSocket handshake has
+// already completed; it does not itself speak HTTP.
+func newConn(cfg connConfig) *Conn {
+	c := &Conn{
+		rwc:             cfg.rwc,
+		client:          cfg.client,
+		copts:           cfg.copts,
+		flateThreshold:  cfg.flateThreshold,
+		br:              cfg.br,
+		bw:              cfg.bw,
+		writeBufferPool: cfg.writeBufferPool,
+	}
+	if c.flateThreshold <= 0 {
+		c.flateThreshold = 128
+	}
+	return c
+}
+
+// Close closes the underlying network connection without sending a close
+// frame.
+func (c *Conn) Close() error {
+	return c.rwc.Close()
+}
+
+// SetWriteCompression controls whether outgoing messages are eligible for
+// permessage-deflate compression at all, independent of flateThreshold.
+// This is for payloads that are already compressed (e.g. JPEG/WebM chunks),
+// where running deflate over them again only burns CPU for no size benefit.
+//
+// It takes effect starting with the next Write/Writer call and must not be
+// called concurrently with one.
+func (c *Conn) SetWriteCompression(enable bool) {
+	c.writeCompressionDisabled = !enable
+}
+
+// SetCompressionLevel sets the flate compression level used for future
+// messages, following the level constants documented on
+// compress/flate.NewWriter (flate.HuffmanOnly through flate.BestCompression).
+// It returns an error if level is out of that range.
+//
+// Because permessage-deflate with CompressionContextTakeover keeps a single
+// flate.Writer alive for the life of the Conn to preserve its dictionary,
+// SetCompressionLevel only affects a context-takeover connection if called
+// before the first compressed message is written; afterwards the existing
+// writer's level cannot be changed without losing that dictionary. It
+// always applies to the next message on a CompressionNoContextTakeover
+// connection, which builds a fresh writer per message.
+func (c *Conn) SetCompressionLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("websocket: invalid compression level %d", level)
+	}
+	c.compressionLevel = level
+	c.compressionLevelSet = true
+	return nil
+}
+
+// flateCompressionLevel returns the level deflate should compress with,
+// defaulting to flate.BestCompression until SetCompressionLevel is called.
+func (c *Conn) flateCompressionLevel() int {
+	if !c.compressionLevelSet {
+		return flate.BestCompression
+	}
+	return c.compressionLevel
+}
+
+// Write writes a message of the given type to the connection. The entire
+// message is buffered in memory and sent as a single frame.
+func (c *Conn) Write(ctx context.Context, typ MessageType, p []byte) error {
+	w, err := c.Writer(ctx, typ)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(p); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// Writer returns a writer for the next message to send on the connection.
+// The message is buffered until Close is called, at which point it is
+// framed and flushed in a single frame. Only one Writer may be open at a
+// time; Close must be called before starting another.
+func (c *Conn) Writer(ctx context.Context, typ MessageType) (io.WriteCloser, error) {
+	c.writeMu.Lock()
+	return &messageWriter{c: c, typ: typ}, nil
+}
+
+// messageWriter implements io.WriteCloser for a single outgoing message.
+type messageWriter struct {
+	c   *Conn
+	typ MessageType
+	buf bytes.Buffer
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *messageWriter) Close() error {
+	defer w.c.writeMu.Unlock()
+	return w.c.writeMessage(w.typ, w.buf.Bytes())
+}
+
+// writeMessage compresses p if appropriate and writes it as a single
+// frame.
+func (c *Conn) writeMessage(typ MessageType, p []byte) error {
+	useFlate := c.copts.enabled() && !c.writeCompressionDisabled && len(p) >= c.flateThreshold
+
+	payload := p
+	if useFlate {
+		compressed, err := c.compress(p)
+		if err != nil {
+			return fmt.Errorf("failed to compress message: %w", err)
+		}
+		payload = compressed
+	}
+
+	h := frameHeader{
+		fin:           true,
+		rsv1:          useFlate,
+		opcode:        opcode(typ),
+		masked:        c.client,
+		payloadLength: int64(len(payload)),
+	}
+	if h.masked {
+		h.maskKey = newMaskKey()
+		mask(h.maskKey, payload)
+	}
+
+	return c.writeFrame(h, payload)
+}
+
+// writeFrame writes a single frame with header h and payload to the
+// connection.
+//
+// When c.writeBufferPool is nil, it frames directly into the persistent
+// c.bw, as before. When a pool is set, the scratch buffer used to assemble
+// the frame is checked out of the pool for the duration of this call and
+// returned once the frame has been written to the underlying connection,
+// instead of c.bw staying allocated for the Conn's entire lifetime.
+func (c *Conn) writeFrame(h frameHeader, payload []byte) error {
+	if c.writeBufferPool == nil {
+		if err := writeFrameHeader(h, c.bw, c.headerBuf[:]); err != nil {
+			return err
+		}
+		if _, err := c.bw.Write(payload); err != nil {
+			return fmt.Errorf("failed to write payload: %w", err)
+		}
+		return c.bw.Flush()
+	}
+
+	bufPtr := c.writeBufferPool.Get()
+	buf := bytes.NewBuffer((*bufPtr)[:0])
+	defer func() {
+		*bufPtr = buf.Bytes()[:0]
+		c.writeBufferPool.Put(bufPtr)
+	}()
+
+	if err := writeFrameHeader(h, buf, c.headerBuf[:]); err != nil {
+		return err
+	}
+	if _, err := buf.Write(payload); err != nil {
+		return fmt.Errorf("failed to write payload: %w", err)
+	}
+	if _, err := c.rwc.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// compress compresses p using whichever CompressionCodec was negotiated,
+// falling back to the built-in permessage-deflate path (which alone
+// supports CompressionContextTakeover and window bits reduction) when none
+// was, or when the negotiated codec is permessage-deflate itself.
+func (c *Conn) compress(p []byte) ([]byte, error) {
+	if !isDeflate(c.copts.codec) {
+		var buf bytes.Buffer
+		cw := c.copts.codec.NewWriter(&buf)
+		if _, err := cw.Write(p); err != nil {
+			return nil, fmt.Errorf("failed to write to %s writer: %w", c.copts.codec.Extension(), err)
+		}
+		if err := cw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close %s writer: %w", c.copts.codec.Extension(), err)
+		}
+		return buf.Bytes(), nil
+	}
+	return c.deflate(p)
+}
+
+// decompress decompresses p using whichever CompressionCodec was
+// negotiated; see compress.
+func (c *Conn) decompress(p []byte) ([]byte, error) {
+	if !isDeflate(c.copts.codec) {
+		cr := c.copts.codec.NewReader(bytes.NewReader(p))
+		defer cr.Close()
+		return io.ReadAll(cr)
+	}
+	return c.inflate(p)
+}
+
+// deflate compresses p according to the connection's negotiated compression
+// options, returning the compressed bytes with the RFC 7692 4 byte trailer
+// stripped.
+func (c *Conn) deflate(p []byte) ([]byte, error) {
+	var buf *bytes.Buffer
+	if c.writeBufferPool != nil {
+		bufPtr := c.writeBufferPool.Get()
+		buf = bytes.NewBuffer((*bufPtr)[:0])
+		defer func() {
+			*bufPtr = buf.Bytes()[:0]
+			c.writeBufferPool.Put(bufPtr)
+		}()
+	} else {
+		buf = new(bytes.Buffer)
+	}
+
+	windowBits := c.copts.writeWindowBits(c.client)
+	noContextTakeover := c.copts.writeNoContextTakeover(c.client)
+
+	var fw *flate.Writer
+	switch {
+	case windowBits < defaultWindowBits:
+		// The stdlib flate package has no way to cap a Writer's LZ77 window
+		// below its fixed 32KiB, so a smaller client_max_window_bits/
+		// server_max_window_bits is approximated by seeding a fresh Writer's
+		// dictionary with only the last 1<<windowBits bytes we've sent,
+		// rather than keeping one Writer (and its full window) alive across
+		// messages.
+		if c.writeWindow.buf == nil {
+			c.writeWindow.init(1 << windowBits)
+		}
+		var err error
+		fw, err = flate.NewWriterDict(buf, c.flateCompressionLevel(), c.writeWindow.buf)
+		if err != nil {
+			return nil, err
+		}
+		if !noContextTakeover {
+			c.writeWindow.write(p)
+		}
+	case noContextTakeover:
+		var err error
+		fw, err = flate.NewWriter(buf, c.flateCompressionLevel())
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if c.flateWriter == nil {
+			c.flateWriteProxy.w = buf
+			var err error
+			c.flateWriter, err = flate.NewWriter(&c.flateWriteProxy, c.flateCompressionLevel())
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			c.flateWriteProxy.w = buf
+		}
+		fw = c.flateWriter
+	}
+
+	if _, err := fw.Write(p); err != nil {
+		return nil, fmt.Errorf("failed to write to flate writer: %w", err)
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush flate writer: %w", err)
+	}
+
+	b := buf.Bytes()
+	if bytes.HasSuffix(b, deflateFinalBlock) {
+		b = b[:len(b)-len(deflateFinalBlock)]
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// Read reads the next message from the connection.
+func (c *Conn) Read(ctx context.Context) (MessageType, []byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	// c.headerBuf belongs to the write path, which may run concurrently.
+	var headerBuf [8]byte
+	h, err := readFrameHeader(c.br, headerBuf[:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read frame header: %w", err)
+	}
+
+	p := make([]byte, h.payloadLength)
+	if _, err := io.ReadFull(c.br, p); err != nil {
+		return 0, nil, fmt.Errorf("failed to read payload: %w", err)
+	}
+	if h.masked {
+		mask(h.maskKey, p)
+	}
+
+	if h.rsv1 {
+		p, err = c.decompress(p)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to decompress message: %w", err)
+		}
+	}
+
+	return MessageType(h.opcode), p, nil
+}
+
+// inflate decompresses p, which must have come from a frame with RSV1 set,
+// according to the connection's negotiated compression options.
+//
+// Unlike deflate, this cannot reuse a persistent flate.Reader by simply
+// redirecting its source: RFC 7692 messages are written as independent,
+// individually-terminated DEFLATE streams (see deflateReadTail), and
+// compress/flate's decompressor forgets its dictionary once a stream
+// terminates. So context takeover on the read side is instead implemented
+// by tracking the plaintext we've decoded in a slidingWindow and explicitly
+// handing it to the decompressor as a preset dictionary via Resetter.Reset
+// before each message.
+func (c *Conn) inflate(p []byte) ([]byte, error) {
+	p = append(p, deflateFinalBlock...)
+	p = append(p, deflateReadTail...)
+
+	if c.copts.readNoContextTakeover(c.client) {
+		rc := flate.NewReader(bytes.NewReader(p))
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	if c.readWindow.buf == nil {
+		c.readWindow.init(1 << c.copts.readWindowBits(c.client))
+	}
+
+	if c.flateReader == nil {
+		c.flateReader = flate.NewReader(bytes.NewReader(p))
+	} else if err := c.flateReader.(flate.Resetter).Reset(bytes.NewReader(p), c.readWindow.buf); err != nil {
+		return nil, fmt.Errorf("failed to reset flate reader: %w", err)
+	}
+
+	out, err := io.ReadAll(c.flateReader)
+	if err != nil {
+		return nil, err
+	}
+	c.readWindow.write(out)
+	return out, nil
+}
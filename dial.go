@@ -0,0 +1,84 @@
+package websocket
+
+import "fmt"
+
+// offerDeflate builds the Sec-WebSocket-Extensions header value a client
+// should send to offer permessage-deflate according to mode and limits.
+func offerDeflate(mode CompressionMode, limits CompressionOptions) string {
+	if mode == CompressionDisabled {
+		return ""
+	}
+
+	parts := []string{"permessage-deflate"}
+	switch mode {
+	case CompressionNoContextTakeover:
+		parts = append(parts, "client_no_context_takeover", "server_no_context_takeover")
+	case CompressionServerNoTakeover:
+		parts = append(parts, "server_no_context_takeover")
+	}
+	if limits.ClientMaxWindowBits != 0 {
+		parts = append(parts, fmt.Sprintf("client_max_window_bits=%d", limits.ClientMaxWindowBits))
+	} else {
+		// A bare client_max_window_bits tells the server it may pick any
+		// value up to 15 for us; servers that don't support reducing the
+		// window at all are free to ignore it.
+		parts = append(parts, "client_max_window_bits")
+	}
+	if limits.ServerMaxWindowBits != 0 {
+		parts = append(parts, fmt.Sprintf("server_max_window_bits=%d", limits.ServerMaxWindowBits))
+	}
+
+	return joinExtensionParts(parts)
+}
+
+func joinExtensionParts(parts []string) string {
+	out := parts[0]
+	for _, p := range parts[1:] {
+		out += "; " + p
+	}
+	return out
+}
+
+// parseDeflateResponse builds the compressionOptions a client should use
+// given the Sec-WebSocket-Extensions header the server responded with to an
+// offer made with mode.
+func parseDeflateResponse(mode CompressionMode, response string) (*compressionOptions, error) {
+	params, found := parseDeflateOffer(response)
+	if !found {
+		return nil, nil
+	}
+
+	co := mode.opts()
+	if co == nil {
+		// The server accepted an extension we didn't actually offer
+		// (CompressionDisabled); treat this defensively as no compression.
+		return nil, nil
+	}
+
+	if _, present := params["client_no_context_takeover"]; present {
+		co.clientNoContextTakeover = true
+	}
+	if _, present := params["server_no_context_takeover"]; present {
+		co.serverNoContextTakeover = true
+	}
+
+	if bits, present, err := windowBitsParam(params, "client_max_window_bits"); err != nil {
+		return nil, err
+	} else if present {
+		if bits == 0 {
+			bits = defaultWindowBits
+		}
+		co.clientMaxWindowBits = bits
+	}
+
+	if bits, present, err := windowBitsParam(params, "server_max_window_bits"); err != nil {
+		return nil, err
+	} else if present {
+		if bits == 0 {
+			bits = defaultWindowBits
+		}
+		co.serverMaxWindowBits = bits
+	}
+
+	return co, nil
+}
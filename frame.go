@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// frameWriter is the subset of *bufio.Writer and *bytes.Buffer that
+// writeFrameHeader needs, so it can target either a Conn's persistent
+// bufio.Writer or a scratch buffer checked out of a BufferPool.
+type frameWriter interface {
+	io.Writer
+	io.ByteWriter
+}
+
+// opcode identifies the type of a WebSocket frame as defined in RFC 6455
+// Section 5.2.
+type opcode int
+
+const (
+	opContinuation opcode = 0x0
+	opText         opcode = 0x1
+	opBinary       opcode = 0x2
+	opClose        opcode = 0x8
+	opPing         opcode = 0x9
+	opPong         opcode = 0xA
+)
+
+// frameHeader describes the header of a single WebSocket frame.
+//
+// This implementation only ever sends and receives whole messages in a
+// single frame (fin always true), but the header still models the full
+// RFC 6455 layout so that readFrameHeader/writeFrameHeader can be reused
+// unchanged if fragmentation is added later.
+type frameHeader struct {
+	fin  bool
+	rsv1 bool
+	rsv2 bool
+	rsv3 bool
+
+	opcode opcode
+
+	masked  bool
+	maskKey uint32
+
+	payloadLength int64
+}
+
+// readFrameHeader reads a frame header from r. buf is used as scratch space
+// and must be at least 8 bytes long.
+func readFrameHeader(r *bufio.Reader, buf []byte) (frameHeader, error) {
+	var h frameHeader
+
+	b0, err := r.ReadByte()
+	if err != nil {
+		return h, fmt.Errorf("failed to read first header byte: %w", err)
+	}
+	h.fin = b0&(1<<7) != 0
+	h.rsv1 = b0&(1<<6) != 0
+	h.rsv2 = b0&(1<<5) != 0
+	h.rsv3 = b0&(1<<4) != 0
+	h.opcode = opcode(b0 & 0xf)
+
+	b1, err := r.ReadByte()
+	if err != nil {
+		return h, fmt.Errorf("failed to read second header byte: %w", err)
+	}
+	h.masked = b1&(1<<7) != 0
+
+	payloadLength := int64(b1 &^ (1 << 7))
+	switch payloadLength {
+	case 126:
+		if _, err := io.ReadFull(r, buf[:2]); err != nil {
+			return h, fmt.Errorf("failed to read 16 bit payload length: %w", err)
+		}
+		payloadLength = int64(binary.BigEndian.Uint16(buf))
+	case 127:
+		if _, err := io.ReadFull(r, buf[:8]); err != nil {
+			return h, fmt.Errorf("failed to read 64 bit payload length: %w", err)
+		}
+		payloadLength = int64(binary.BigEndian.Uint64(buf))
+	}
+	h.payloadLength = payloadLength
+
+	if h.masked {
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return h, fmt.Errorf("failed to read mask key: %w", err)
+		}
+		h.maskKey = binary.LittleEndian.Uint32(buf)
+	}
+
+	return h, nil
+}
+
+// writeFrameHeader writes h to w. buf is used as scratch space and must be
+// at least 8 bytes long.
+func writeFrameHeader(h frameHeader, w frameWriter, buf []byte) error {
+	b0 := byte(h.opcode)
+	if h.fin {
+		b0 |= 1 << 7
+	}
+	if h.rsv1 {
+		b0 |= 1 << 6
+	}
+	if h.rsv2 {
+		b0 |= 1 << 5
+	}
+	if h.rsv3 {
+		b0 |= 1 << 4
+	}
+	if err := w.WriteByte(b0); err != nil {
+		return fmt.Errorf("failed to write first header byte: %w", err)
+	}
+
+	var b1 byte
+	if h.masked {
+		b1 |= 1 << 7
+	}
+
+	switch {
+	case h.payloadLength <= 125:
+		if err := w.WriteByte(b1 | byte(h.payloadLength)); err != nil {
+			return fmt.Errorf("failed to write payload length: %w", err)
+		}
+	case h.payloadLength <= 65535:
+		if err := w.WriteByte(b1 | 126); err != nil {
+			return fmt.Errorf("failed to write payload length: %w", err)
+		}
+		binary.BigEndian.PutUint16(buf, uint16(h.payloadLength))
+		if _, err := w.Write(buf[:2]); err != nil {
+			return fmt.Errorf("failed to write 16 bit payload length: %w", err)
+		}
+	default:
+		if err := w.WriteByte(b1 | 127); err != nil {
+			return fmt.Errorf("failed to write payload length: %w", err)
+		}
+		binary.BigEndian.PutUint64(buf, uint64(h.payloadLength))
+		if _, err := w.Write(buf[:8]); err != nil {
+			return fmt.Errorf("failed to write 64 bit payload length: %w", err)
+		}
+	}
+
+	if h.masked {
+		binary.LittleEndian.PutUint32(buf, h.maskKey)
+		if _, err := w.Write(buf[:4]); err != nil {
+			return fmt.Errorf("failed to write mask key: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+// Package assert contains small testing helpers shared across this module's
+// test files.
+package assert
+
+import "testing"
+
+// Success fails the test immediately if err is non-nil.
+func Success(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Equal fails the test if want and got are not equal, reporting name to
+// identify which comparison failed.
+func Equal[T comparable](t *testing.T, name string, want, got T) {
+	t.Helper()
+	if want != got {
+		t.Fatalf("%s: want %v, got %v", name, want, got)
+	}
+}
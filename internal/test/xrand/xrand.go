@@ -0,0 +1,24 @@
+// Package xrand contains small randomized-testing helpers shared across this
+// module's test files.
+package xrand
+
+import "math/rand"
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// String returns a random string of length n composed of letters and digits.
+func String(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+// Int returns a random integer in [0, n).
+func Int(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return rand.Intn(n)
+}
@@ -0,0 +1,17 @@
+package websocket
+
+import "math/rand"
+
+// newMaskKey generates a new random masking key for a client frame, as
+// required by RFC 6455 Section 5.3.
+func newMaskKey() uint32 {
+	return rand.Uint32()
+}
+
+// mask applies the WebSocket masking algorithm to p in place using key.
+func mask(key uint32, p []byte) {
+	keyBytes := [4]byte{byte(key), byte(key >> 8), byte(key >> 16), byte(key >> 24)}
+	for i := range p {
+		p[i] ^= keyBytes[i%4]
+	}
+}
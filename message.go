@@ -0,0 +1,13 @@
+package websocket
+
+// MessageType represents the type of a WebSocket message, as defined in
+// RFC 6455 Section 5.6.
+type MessageType int
+
+const (
+	// MessageText is a message composed of UTF-8 encoded text.
+	MessageText MessageType = MessageType(opText)
+
+	// MessageBinary is a message composed of arbitrary binary data.
+	MessageBinary MessageType = MessageType(opBinary)
+)
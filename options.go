@@ -0,0 +1,48 @@
+package websocket
+
+// AcceptOptions configures Accept, the server side of a WebSocket
+// handshake.
+type AcceptOptions struct {
+	// CompressionMode controls the permessage-deflate compression applied to
+	// messages sent and received on the accepted Conn. The zero value is
+	// CompressionDisabled.
+	CompressionMode CompressionMode
+
+	// CompressionOptions caps the permessage-deflate window bits this server
+	// is willing to negotiate with a client, independent of CompressionMode.
+	CompressionOptions CompressionOptions
+
+	// CompressionCodecs lists additional CompressionCodecs, beyond the
+	// always-available permessage-deflate, that this server will accept, in
+	// preference order. The first entry whose Extension() the client also
+	// offered wins.
+	CompressionCodecs []CompressionCodec
+
+	// WriteBufferPool, if set, is used to check out the scratch buffer
+	// needed to frame and compress each outgoing write instead of pinning
+	// one to the accepted Conn for its whole lifetime. Useful for servers
+	// holding many thousands of mostly-idle connections.
+	WriteBufferPool BufferPool
+}
+
+// DialOptions configures Dial, the client side of a WebSocket handshake.
+type DialOptions struct {
+	// CompressionMode controls the permessage-deflate compression offered to
+	// the server. The zero value is CompressionDisabled.
+	CompressionMode CompressionMode
+
+	// CompressionOptions caps the permessage-deflate window bits this client
+	// offers to use, independent of CompressionMode.
+	CompressionOptions CompressionOptions
+
+	// CompressionCodecs lists additional CompressionCodecs, beyond the
+	// always-available permessage-deflate, that this client offers, in
+	// preference order.
+	CompressionCodecs []CompressionCodec
+
+	// WriteBufferPool, if set, is used to check out the scratch buffer
+	// needed to frame and compress each outgoing write instead of pinning
+	// one to the dialed Conn for its whole lifetime. Useful for clients
+	// holding many thousands of mostly-idle connections.
+	WriteBufferPool BufferPool
+}
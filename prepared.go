@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PreparedMessage caches the compressed payload of a message so that it can
+// be sent to many Conns without repeating the compression work for each
+// one. The frame header (and, for clients, the masking) is still built per
+// Conn.
+//
+// This is intended for fanout: a chat or pubsub server broadcasting the
+// same payload to thousands of subscribers only needs to run deflate once
+// per PreparedMessage rather than once per Conn.Write call.
+type PreparedMessage struct {
+	typ MessageType
+	p   []byte
+
+	once           sync.Once
+	compressedOnce error
+	compressed     []byte
+}
+
+// NewPreparedMessage creates a PreparedMessage from typ and p. p is not
+// copied; callers must not mutate it after passing it in.
+func NewPreparedMessage(typ MessageType, p []byte) *PreparedMessage {
+	return &PreparedMessage{typ: typ, p: p}
+}
+
+// prepareCompressed lazily deflates pm.p the first time it is needed,
+// caching the result for reuse across every Conn that calls
+// WritePreparedMessage with this message.
+func (pm *PreparedMessage) prepareCompressed() ([]byte, error) {
+	pm.once.Do(func() {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			pm.compressedOnce = err
+			return
+		}
+		if _, err := fw.Write(pm.p); err != nil {
+			pm.compressedOnce = err
+			return
+		}
+		if err := fw.Flush(); err != nil {
+			pm.compressedOnce = err
+			return
+		}
+		b := buf.Bytes()
+		if bytes.HasSuffix(b, deflateFinalBlock) {
+			b = b[:len(b)-len(deflateFinalBlock)]
+		}
+		pm.compressed = append([]byte(nil), b...)
+	})
+	return pm.compressed, pm.compressedOnce
+}
+
+// WritePreparedMessage writes pm to c.
+//
+// When c's write direction has no context takeover and is compressing at
+// the default (full) window size, the cached compressed payload is reused
+// directly and no per-connection deflate work is done. WritePreparedMessage
+// falls back to the normal Write path whenever that's not safe: a write
+// direction that retains context takeover would have its sliding-window
+// dictionary corrupted by reused compressed output, a connection with
+// SetWriteCompression(false) expects raw (non-RSV1) frames, and a shrunk
+// client_max_window_bits/server_max_window_bits isn't guaranteed to decode
+// output compressed with the full 32KiB window the cache assumes.
+func (c *Conn) WritePreparedMessage(ctx context.Context, pm *PreparedMessage) error {
+	if c.copts.enabled() &&
+		(!c.copts.writeNoContextTakeover(c.client) ||
+			c.writeCompressionDisabled ||
+			c.copts.writeWindowBits(c.client) != defaultWindowBits) {
+		return c.Write(ctx, pm.typ, pm.p)
+	}
+
+	useFlate := c.copts.enabled() && len(pm.p) >= c.flateThreshold
+
+	payload := pm.p
+	if useFlate {
+		compressed, err := pm.prepareCompressed()
+		if err != nil {
+			return fmt.Errorf("failed to prepare compressed message: %w", err)
+		}
+		payload = compressed
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.client {
+		// Masking is per-connection (the key must be unpredictable per
+		// RFC 6455 Section 10.3), so the masked copy can't be cached on the
+		// PreparedMessage; copy out before masking in place.
+		payload = append([]byte(nil), payload...)
+	}
+
+	h := frameHeader{
+		fin:           true,
+		rsv1:          useFlate,
+		opcode:        opcode(pm.typ),
+		masked:        c.client,
+		payloadLength: int64(len(payload)),
+	}
+	if h.masked {
+		h.maskKey = newMaskKey()
+		mask(h.maskKey, payload)
+	}
+
+	return c.writeFrame(h, payload)
+}
@@ -0,0 +1,97 @@
+//go:build !js
+
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aperturerobotics/go-websocket/internal/test/assert"
+)
+
+// TestWritePreparedMessageFallback verifies that WritePreparedMessage falls
+// back to the normal Write path (no reused cached compressed bytes) for
+// connections where reuse would be unsafe: context takeover, compression
+// disabled via SetWriteCompression, and a shrunk negotiated window size.
+func TestWritePreparedMessageFallback(t *testing.T) {
+	t.Parallel()
+
+	msg := []byte(strings.Repeat("prepared message payload ", 100))
+
+	testCases := []struct {
+		name         string
+		copts        *compressionOptions
+		disableWrite bool // SetWriteCompression(false) before writing
+		wantRsv1     bool // true = compressed, false = uncompressed
+		wantFallback bool // true = cached compressed payload left unused
+	}{
+		{"NoContextTakeover", CompressionNoContextTakeover.opts(), false, true, false},
+		{"ContextTakeoverFallsBack", CompressionContextTakeover.opts(), false, true, true},
+		{"WriteCompressionDisabledFallsBack", CompressionNoContextTakeover.opts(), true, false, true},
+		{
+			"ShrunkWindowFallsBack",
+			&compressionOptions{
+				mode:                    CompressionNoContextTakeover,
+				clientNoContextTakeover: true,
+				serverNoContextTakeover: true,
+				clientMaxWindowBits:     10,
+				serverMaxWindowBits:     defaultWindowBits,
+			},
+			false,
+			true,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			pm := NewPreparedMessage(MessageBinary, msg)
+
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+
+			c := newConn(connConfig{
+				rwc:            clientConn,
+				client:         true,
+				copts:          tc.copts,
+				flateThreshold: 8,
+				br:             bufio.NewReader(clientConn),
+				bw:             bufio.NewWriterSize(clientConn, 4096),
+			})
+			if tc.disableWrite {
+				c.SetWriteCompression(false)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+			defer cancel()
+
+			writeDone := make(chan error, 1)
+			go func() {
+				writeDone <- c.WritePreparedMessage(ctx, pm)
+			}()
+
+			reader := bufio.NewReader(serverConn)
+			readBuf := make([]byte, 8)
+
+			h, err := readFrameHeader(reader, readBuf)
+			assert.Success(t, err)
+
+			_, err = io.CopyN(io.Discard, reader, h.payloadLength)
+			assert.Success(t, err)
+
+			assert.Equal(t, "opcode", opBinary, h.opcode)
+			assert.Equal(t, "rsv1 (compressed)", tc.wantRsv1, h.rsv1)
+
+			assert.Success(t, <-writeDone)
+			assert.Equal(t, "cached payload unused (fell back)", tc.wantFallback, pm.compressed == nil)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package websocket
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// s2Codec is the built-in "permessage-s2" CompressionCodec. S2 is a
+// Snappy-derived compressor that trades some compression ratio for roughly
+// an order of magnitude less CPU than deflate, which matters more than
+// bandwidth for high-throughput messaging workloads.
+type s2Codec struct{}
+
+// NewS2Codec returns the built-in permessage-s2 CompressionCodec for use in
+// AcceptOptions.CompressionCodecs/DialOptions.CompressionCodecs.
+func NewS2Codec() CompressionCodec { return s2Codec{} }
+
+func (s2Codec) Extension() string { return "permessage-s2" }
+
+func (s2Codec) Negotiate(params map[string]string) (bool, error) {
+	// permessage-s2 takes no parameters; any offer naming the extension is
+	// acceptable.
+	return true, nil
+}
+
+func (s2Codec) NewWriter(w io.Writer) io.WriteCloser {
+	return s2.NewWriter(w)
+}
+
+func (s2Codec) NewReader(r io.Reader) io.ReadCloser {
+	return io.NopCloser(s2.NewReader(r))
+}